@@ -0,0 +1,39 @@
+// Package logging provides the structured leveled logger used throughout
+// PacketStreamer, backed by logrus and configurable via config.Log.
+package logging
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+// Log is the process-wide logger. It defaults to info/text so packages
+// that run before Init (or in tests) still get sane output.
+var Log = logrus.New()
+
+func init() {
+	Log.SetOutput(os.Stderr)
+	Log.SetLevel(logrus.InfoLevel)
+	Log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+}
+
+// Init configures Log's level and format from config.Log. It should be
+// called once, early in startup, before any goroutines start logging.
+func Init(cfg *config.Config) {
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		Log.Warnf("Unknown log level %q, defaulting to info", cfg.Log.Level)
+		level = logrus.InfoLevel
+	}
+	Log.SetLevel(level)
+
+	if strings.EqualFold(cfg.Log.Format, "json") {
+		Log.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		Log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+}
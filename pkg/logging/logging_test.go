@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+func TestInitUnparseableLevelFallsBackToInfo(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.Level = "not-a-real-level"
+
+	Init(cfg)
+
+	if Log.GetLevel() != logrus.InfoLevel {
+		t.Fatalf("expected fallback to info level, got %v", Log.GetLevel())
+	}
+}
+
+func TestInitParsesValidLevel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.Level = "debug"
+
+	Init(cfg)
+
+	if Log.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("expected debug level, got %v", Log.GetLevel())
+	}
+}
+
+func TestInitSelectsJSONFormatter(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.Level = "info"
+	cfg.Log.Format = "json"
+
+	Init(cfg)
+
+	if _, ok := Log.Formatter.(*logrus.JSONFormatter); !ok {
+		t.Fatalf("expected JSONFormatter, got %T", Log.Formatter)
+	}
+}
+
+func TestInitDefaultsToTextFormatter(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.Level = "info"
+	cfg.Log.Format = "text"
+
+	Init(cfg)
+
+	if _, ok := Log.Formatter.(*logrus.TextFormatter); !ok {
+		t.Fatalf("expected TextFormatter, got %T", Log.Formatter)
+	}
+}
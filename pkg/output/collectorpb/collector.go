@@ -0,0 +1,135 @@
+// Package collectorpb implements the client side of the PacketStreamer
+// collector streaming protocol by hand, rather than via protoc-generated
+// bindings: PacketFrame and PushFramesSummary are small enough that a
+// generated .pb.go would just be overhead, and it avoids requiring a
+// protoc toolchain to build this package.
+package collectorpb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName registers a content-subtype so this package's hand-rolled
+// wire format can travel over a standard gRPC stream without protobuf.
+const codecName = "packetstreamer-raw"
+
+func init() {
+	encoding.RegisterCodec(rawCodec{})
+}
+
+// wireMessage is implemented by every message type this package sends or
+// receives over the raw codec.
+type wireMessage interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return codecName }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("collectorpb: cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("collectorpb: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// PacketFrame carries a single captured packet payload. On the wire it is
+// just its raw bytes.
+type PacketFrame struct {
+	Data []byte
+}
+
+func (f *PacketFrame) marshal() []byte { return f.Data }
+
+func (f *PacketFrame) unmarshal(data []byte) error {
+	f.Data = append([]byte(nil), data...)
+	return nil
+}
+
+// PushFramesSummary acknowledges how many frames a PushFrames call
+// received. On the wire it is a single big-endian uint64.
+type PushFramesSummary struct {
+	FramesReceived uint64
+}
+
+func (s *PushFramesSummary) marshal() []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, s.FramesReceived)
+	return buf
+}
+
+func (s *PushFramesSummary) unmarshal(data []byte) error {
+	if len(data) != 8 {
+		return fmt.Errorf("collectorpb: malformed PushFramesSummary (%d bytes)", len(data))
+	}
+	s.FramesReceived = binary.BigEndian.Uint64(data)
+	return nil
+}
+
+const pushFramesMethod = "/collectorpb.Collector/PushFrames"
+
+// CollectorClient is the client API for the Collector service: a single
+// client-streaming RPC that pushes packet frames to a remote collector.
+type CollectorClient interface {
+	PushFrames(ctx context.Context, opts ...grpc.CallOption) (Collector_PushFramesClient, error)
+}
+
+type collectorClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewCollectorClient builds a CollectorClient bound to cc.
+func NewCollectorClient(cc *grpc.ClientConn) CollectorClient {
+	return &collectorClient{cc: cc}
+}
+
+func (c *collectorClient) PushFrames(ctx context.Context, opts ...grpc.CallOption) (Collector_PushFramesClient, error) {
+	callOpts := append([]grpc.CallOption{grpc.CallContentSubtype(codecName)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &grpc.StreamDesc{StreamName: "PushFrames", ClientStreams: true}, pushFramesMethod, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &collectorPushFramesClient{stream}, nil
+}
+
+// Collector_PushFramesClient is the client-streaming handle returned by
+// PushFrames.
+type Collector_PushFramesClient interface {
+	Send(*PacketFrame) error
+	CloseAndRecv() (*PushFramesSummary, error)
+}
+
+type collectorPushFramesClient struct {
+	grpc.ClientStream
+}
+
+func (x *collectorPushFramesClient) Send(frame *PacketFrame) error {
+	return x.ClientStream.SendMsg(frame)
+}
+
+func (x *collectorPushFramesClient) CloseAndRecv() (*PushFramesSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	summary := new(PushFramesSummary)
+	if err := x.ClientStream.RecvMsg(summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,41 @@
+package output
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+// consoleOutput writes packet payloads to stdout or a plain file, matching
+// the behavior of the original single-writer receiver output path.
+type consoleOutput struct {
+	file *os.File
+}
+
+func newConsoleOutput(sc config.SinkConfig) (Output, error) {
+	if sc.Path == "" || sc.Path == "-" {
+		return &consoleOutput{file: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(sc.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open output file %s: %v", sc.Path, err)
+	}
+	return &consoleOutput{file: f}, nil
+}
+
+func (c *consoleOutput) Write(data []byte) error {
+	_, err := c.file.Write(data)
+	return err
+}
+
+func (c *consoleOutput) Flush() error {
+	return c.file.Sync()
+}
+
+func (c *consoleOutput) Close() error {
+	if c.file == os.Stdout {
+		return nil
+	}
+	return c.file.Close()
+}
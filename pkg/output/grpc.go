@@ -0,0 +1,67 @@
+package output
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+	pb "github.com/deepfence/PacketStreamer/pkg/output/collectorpb"
+)
+
+// grpcOutput streams packet frames to a remote collector over a
+// client-streaming gRPC call, reconnecting the stream lazily on error.
+type grpcOutput struct {
+	conn   *grpc.ClientConn
+	client pb.CollectorClient
+	stream pb.Collector_PushFramesClient
+}
+
+func newGrpcOutput(sc config.SinkConfig) (Output, error) {
+	conn, err := grpc.Dial(sc.GrpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial gRPC collector at %s: %v", sc.GrpcAddress, err)
+	}
+	client := pb.NewCollectorClient(conn)
+	g := &grpcOutput{conn: conn, client: client}
+	if err := g.connectStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *grpcOutput) connectStream() error {
+	stream, err := g.client.PushFrames(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to open gRPC frame stream: %v", err)
+	}
+	g.stream = stream
+	return nil
+}
+
+func (g *grpcOutput) Write(data []byte) error {
+	frame := &pb.PacketFrame{Data: append([]byte(nil), data...)}
+	if err := g.stream.Send(frame); err != nil {
+		if reconnErr := g.connectStream(); reconnErr != nil {
+			return fmt.Errorf("unable to send frame and reconnect failed: %v / %v", err, reconnErr)
+		}
+		if err := g.stream.Send(frame); err != nil {
+			return fmt.Errorf("unable to send frame after reconnect: %v", err)
+		}
+	}
+	return nil
+}
+
+func (g *grpcOutput) Flush() error {
+	return nil
+}
+
+func (g *grpcOutput) Close() error {
+	if g.stream != nil {
+		_, _ = g.stream.CloseAndRecv()
+	}
+	return g.conn.Close()
+}
@@ -0,0 +1,44 @@
+package output
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+// kafkaOutput publishes each packet payload as a single Kafka message.
+type kafkaOutput struct {
+	writer *kafka.Writer
+}
+
+func newKafkaOutput(sc config.SinkConfig) (Output, error) {
+	if sc.KafkaTopic == "" {
+		return nil, fmt.Errorf("kafka sink requires a topic")
+	}
+	return &kafkaOutput{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(sc.KafkaBrokers...),
+			Topic:    sc.KafkaTopic,
+			Balancer: &kafka.LeastBytes{},
+		},
+	}, nil
+}
+
+func (k *kafkaOutput) Write(data []byte) error {
+	msg := kafka.Message{Value: append([]byte(nil), data...)}
+	if err := k.writer.WriteMessages(context.Background(), msg); err != nil {
+		return fmt.Errorf("unable to publish to kafka topic %s: %v", k.writer.Topic, err)
+	}
+	return nil
+}
+
+func (k *kafkaOutput) Flush() error {
+	return nil
+}
+
+func (k *kafkaOutput) Close() error {
+	return k.writer.Close()
+}
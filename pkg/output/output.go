@@ -0,0 +1,168 @@
+// Package output implements the PacketStreamer sink fan-out subsystem.
+//
+// A single stream of captured packets can be teed to any number of
+// independently configured sinks (local files, S3, Kafka, a remote gRPC
+// collector, ...). Each sink runs its own goroutine with a bounded queue
+// so a slow or unavailable sink cannot stall the others, unless its drop
+// policy is Block: Manager.Write then waits for room in that sink's queue
+// before handing the packet to the sinks after it.
+package output
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+// Output is implemented by every packet sink.
+type Output interface {
+	// Write sends a single packet payload to the sink.
+	Write(data []byte) error
+	// Flush forces any buffered data to be persisted/sent.
+	Flush() error
+	// Close releases the sink's resources. No further Write calls are made
+	// once Close has been called.
+	Close() error
+}
+
+// DropPolicy controls what happens when a sink's queue is full.
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "drop-oldest"
+	DropNewest DropPolicy = "drop-newest"
+	Block      DropPolicy = "block"
+)
+
+const defaultQueueSize = 1000
+
+// sink pairs an Output with the bounded queue and backpressure policy that
+// feed it.
+type sink struct {
+	name     string
+	out      Output
+	queue    chan []byte
+	policy   DropPolicy
+	dropped  uint64
+	doneChan chan struct{}
+}
+
+func newSink(name string, out Output, queueSize int, policy DropPolicy) *sink {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	s := &sink{
+		name:     name,
+		out:      out,
+		queue:    make(chan []byte, queueSize),
+		policy:   policy,
+		doneChan: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *sink) run() {
+	defer close(s.doneChan)
+	for data := range s.queue {
+		if err := s.out.Write(data); err != nil {
+			log.Printf("Sink %s: write failed. Reason %v\n", s.name, err)
+		}
+	}
+	if err := s.out.Close(); err != nil {
+		log.Printf("Sink %s: close failed. Reason %v\n", s.name, err)
+	}
+}
+
+// enqueue applies the sink's drop policy and hands data to the sink's
+// worker goroutine.
+func (s *sink) enqueue(data []byte) {
+	switch s.policy {
+	case Block:
+		s.queue <- data
+	case DropOldest:
+		select {
+		case s.queue <- data:
+		default:
+			select {
+			case <-s.queue:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+			select {
+			case s.queue <- data:
+			default:
+				atomic.AddUint64(&s.dropped, 1)
+			}
+		}
+	default: // DropNewest
+		select {
+		case s.queue <- data:
+		default:
+			if atomic.AddUint64(&s.dropped, 1)%100 == 1 {
+				log.Printf("Sink %s: queue full, dropped %d frames so far\n", s.name, atomic.LoadUint64(&s.dropped))
+			}
+		}
+	}
+}
+
+// Manager fans a single packet stream out to every configured sink.
+type Manager struct {
+	sinks []*sink
+}
+
+// NewManager builds a Manager from the sinks listed in config.Output.Sinks.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{}
+	for _, sc := range cfg.Output.Sinks {
+		out, err := newSinkOutput(cfg, sc)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize sink %q: %v", sc.Name, err)
+		}
+		policy := DropPolicy(sc.DropPolicy)
+		if policy == "" {
+			policy = DropNewest
+		}
+		m.sinks = append(m.sinks, newSink(sc.Name, out, sc.QueueSize, policy))
+	}
+	return m, nil
+}
+
+// newSinkOutput constructs the concrete Output implementation for a single
+// configured sink.
+func newSinkOutput(cfg *config.Config, sc config.SinkConfig) (Output, error) {
+	switch sc.Type {
+	case "file", "console":
+		return newConsoleOutput(sc)
+	case "pcap":
+		return newPcapOutput(sc)
+	case "s3":
+		return newS3Output(sc)
+	case "kafka":
+		return newKafkaOutput(sc)
+	case "grpc":
+		return newGrpcOutput(sc)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+	}
+}
+
+// Write fans data out to every sink's queue, applying each sink's own
+// backpressure/drop policy.
+func (m *Manager) Write(data []byte) {
+	for _, s := range m.sinks {
+		s.enqueue(data)
+	}
+}
+
+// Close stops accepting writes and waits for every sink to drain and close.
+func (m *Manager) Close() {
+	for _, s := range m.sinks {
+		close(s.queue)
+	}
+	for _, s := range m.sinks {
+		<-s.doneChan
+	}
+}
@@ -0,0 +1,158 @@
+package output
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOutput is an in-process Output that records every write and can be
+// held open with writesBlocked until the test releases it, so tests can
+// deterministically observe a sink's drop policy against a slow
+// downstream instead of racing the worker goroutine.
+type fakeOutput struct {
+	mu            sync.Mutex
+	writes        [][]byte
+	writesBlocked chan struct{}
+	writeStarted  chan struct{}
+	closed        bool
+}
+
+func newFakeOutput() *fakeOutput {
+	return &fakeOutput{writeStarted: make(chan struct{}, 16)}
+}
+
+func (f *fakeOutput) Write(data []byte) error {
+	f.writeStarted <- struct{}{}
+	if f.writesBlocked != nil {
+		<-f.writesBlocked
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes = append(f.writes, append([]byte(nil), data...))
+	return nil
+}
+
+func (f *fakeOutput) Flush() error { return nil }
+
+func (f *fakeOutput) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeOutput) writeCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.writes)
+}
+
+// TestSinkEnqueueDropOldest fills the queue while the worker is stalled on
+// a write, then asserts the sink evicts the oldest queued frame to make
+// room for the newest one instead of dropping the newest.
+func TestSinkEnqueueDropOldest(t *testing.T) {
+	out := newFakeOutput()
+	out.writesBlocked = make(chan struct{})
+
+	s := newSink("test", out, 1, DropOldest)
+	defer func() {
+		close(out.writesBlocked) // release the worker stalled on "a" so it can drain and exit
+		close(s.queue)
+		<-s.doneChan
+	}()
+
+	s.enqueue([]byte("a"))
+	<-out.writeStarted // worker dequeued "a" and is now blocked writing it; queue is empty
+
+	s.enqueue([]byte("b")) // fills the now-empty queue
+	s.enqueue([]byte("c")) // queue full with "b"; DropOldest should evict "b" and keep "c"
+
+	if got := <-s.queue; string(got) != "c" {
+		t.Fatalf("expected DropOldest to keep the newest frame %q, got %q", "c", got)
+	}
+}
+
+// TestSinkEnqueueDropNewest asserts the default policy discards the frame
+// being enqueued, leaving the queue's existing contents untouched.
+func TestSinkEnqueueDropNewest(t *testing.T) {
+	out := newFakeOutput()
+	out.writesBlocked = make(chan struct{})
+
+	s := newSink("test", out, 1, DropNewest)
+	defer func() {
+		close(out.writesBlocked) // release the worker stalled on "a" so it can drain and exit
+		close(s.queue)
+		<-s.doneChan
+	}()
+
+	s.enqueue([]byte("a"))
+	<-out.writeStarted // worker dequeued "a" and is now blocked writing it; queue is empty
+
+	s.enqueue([]byte("b")) // fills the now-empty queue
+	s.enqueue([]byte("c")) // queue full with "b"; DropNewest should drop "c" and keep "b"
+
+	if got := <-s.queue; string(got) != "b" {
+		t.Fatalf("expected DropNewest to keep the existing frame %q, got %q", "b", got)
+	}
+}
+
+// TestSinkEnqueueBlock asserts a Block sink's enqueue genuinely blocks
+// until the worker drains space, rather than dropping.
+func TestSinkEnqueueBlock(t *testing.T) {
+	out := newFakeOutput()
+	out.writesBlocked = make(chan struct{})
+
+	s := newSink("test", out, 1, Block)
+
+	s.enqueue([]byte("a"))
+	<-out.writeStarted // worker dequeued "a" and is now blocked writing it; queue is empty
+
+	s.enqueue([]byte("b")) // fills the now-empty queue
+
+	enqueueReturned := make(chan struct{})
+	go func() {
+		s.enqueue([]byte("c")) // queue is full; must block until "b" is dequeued
+		close(enqueueReturned)
+	}()
+
+	select {
+	case <-enqueueReturned:
+		t.Fatal("expected Block enqueue to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(out.writesBlocked) // let the worker finish writing "a" and dequeue "b"
+
+	select {
+	case <-enqueueReturned:
+	case <-time.After(time.Second):
+		t.Fatal("expected Block enqueue to unblock once the worker drained the queue")
+	}
+
+	close(s.queue)
+	<-s.doneChan
+}
+
+// TestManagerCloseDrainsAllSinks asserts Close waits for every sink to
+// finish writing what's already queued (and to call Output.Close) instead
+// of tearing them down immediately.
+func TestManagerCloseDrainsAllSinks(t *testing.T) {
+	outA := newFakeOutput()
+	outB := newFakeOutput()
+	m := &Manager{sinks: []*sink{
+		newSink("a", outA, 4, Block),
+		newSink("b", outB, 4, Block),
+	}}
+
+	m.sinks[0].enqueue([]byte("1"))
+	m.sinks[1].enqueue([]byte("2"))
+	m.Close()
+
+	if outA.writeCount() != 1 || !outA.closed {
+		t.Fatalf("expected sink a to be drained and closed, got writes=%d closed=%v", outA.writeCount(), outA.closed)
+	}
+	if outB.writeCount() != 1 || !outB.closed {
+		t.Fatalf("expected sink b to be drained and closed, got writes=%d closed=%v", outB.writeCount(), outB.closed)
+	}
+}
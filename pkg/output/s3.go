@@ -0,0 +1,78 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+// s3Output buffers rolled segments and multipart-uploads each one to a
+// configured bucket/prefix once it crosses the configured size.
+type s3Output struct {
+	bucket   string
+	prefix   string
+	uploader *s3manager.Uploader
+	maxBytes int64
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	seqNum int64
+}
+
+func newS3Output(sc config.SinkConfig) (Output, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(sc.S3Region)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create AWS session: %v", err)
+	}
+	return &s3Output{
+		bucket:   sc.S3Bucket,
+		prefix:   sc.S3Prefix,
+		uploader: s3manager.NewUploader(sess),
+		maxBytes: sc.RolloverBytes,
+	}, nil
+}
+
+func (s *s3Output) Write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(data)
+	if s.maxBytes > 0 && int64(s.buf.Len()) >= s.maxBytes {
+		return s.uploadLocked()
+	}
+	return nil
+}
+
+func (s *s3Output) uploadLocked() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s/%d-%d.bin", s.prefix, time.Now().UnixNano(), s.seqNum)
+	s.seqNum++
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(s.buf.Bytes()),
+	})
+	s.buf.Reset()
+	if err != nil {
+		return fmt.Errorf("unable to upload segment %s to s3://%s: %v", key, s.bucket, err)
+	}
+	return nil
+}
+
+func (s *s3Output) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploadLocked()
+}
+
+func (s *s3Output) Close() error {
+	return s.Flush()
+}
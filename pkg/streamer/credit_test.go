@@ -0,0 +1,60 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestWriteCreditFrame(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- writeCreditFrame(serverSide, 42)
+	}()
+
+	buf := make([]byte, creditFrameLen)
+	if _, err := clientSide.Read(buf); err != nil {
+		t.Fatalf("unable to read credit frame: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	if string(buf[:len(creditFrameMagic)]) != string(creditFrameMagic[:]) {
+		t.Fatalf("unexpected magic: %v", buf[:len(creditFrameMagic)])
+	}
+	got := binary.BigEndian.Uint32(buf[len(creditFrameMagic):])
+	if got != 42 {
+		t.Fatalf("got credits %d, want 42", got)
+	}
+}
+
+// TestNewCreditControllerDisablesWireAdvertiseForWrappedConns guards
+// against writing raw credit-grant bytes onto a conn whose framing a
+// credit frame would corrupt: a mux stream would carry it as ordinary
+// stream data, and a secure conn would AEAD-seal it as if it were capture
+// payload. Neither protocol has any notion of a credit frame arriving
+// through that channel, so wire-level advertisement must stay off there.
+func TestNewCreditControllerDisablesWireAdvertiseForWrappedConns(t *testing.T) {
+	_, plainConn := net.Pipe()
+	defer plainConn.Close()
+
+	plain := newCreditController(plainConn, make(chan CompressData, 1))
+	if !plain.advertiseOnWire {
+		t.Fatal("expected wire advertisement to be enabled for a plain connection")
+	}
+
+	mux := newCreditController(&muxConn{session: &muxSession{conn: plainConn}}, make(chan CompressData, 1))
+	if mux.advertiseOnWire {
+		t.Fatal("expected wire advertisement to be disabled for a mux stream")
+	}
+
+	secure := newCreditController(&secureConn{Conn: plainConn}, make(chan CompressData, 1))
+	if secure.advertiseOnWire {
+		t.Fatal("expected wire advertisement to be disabled for a secure conn")
+	}
+}
@@ -0,0 +1,220 @@
+package streamer
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"crypto/sha256"
+
+	"github.com/deepfence/PacketStreamer/pkg/config"
+)
+
+const (
+	x25519KeyLen    = 32
+	connIDLen       = 4
+	nonceCounterLen = 8
+)
+
+// authConfirmMsg is exchanged once keys are derived so a mismatched PSK
+// (the two sides ending up with different keys) fails the handshake
+// immediately via an AEAD error, instead of only surfacing later as a
+// frame decrypt failure on whatever capture data happens to arrive first.
+var authConfirmMsg = []byte("packetstreamer-auth-ok")
+
+// performAuthHandshake runs an ephemeral X25519 + HKDF-SHA256 key exchange
+// over hostConn, mixing in the shared PSK from config.Auth.Key, and returns
+// a net.Conn that transparently encrypts/decrypts every frame with
+// ChaCha20-Poly1305. It supersedes the boolean handleServerAuth check when
+// config.Auth.Key is configured, giving PacketStreamer confidentiality and
+// integrity in transit without requiring a TLS PKI.
+func performAuthHandshake(hostConn net.Conn, cfg *config.Config) (net.Conn, error) {
+	psk := []byte(cfg.Auth.Key)
+	maxFrameLen := cfg.CompressBlockSize*kilobyte + chacha20poly1305.Overhead
+	var serverPriv, serverPub [x25519KeyLen]byte
+	if _, err := io.ReadFull(rand.Reader, serverPriv[:]); err != nil {
+		return nil, fmt.Errorf("unable to generate ephemeral keypair: %v", err)
+	}
+	curve25519.ScalarBaseMult(&serverPub, &serverPriv)
+
+	var serverConnID [connIDLen]byte
+	if _, err := io.ReadFull(rand.Reader, serverConnID[:]); err != nil {
+		return nil, fmt.Errorf("unable to generate connection id: %v", err)
+	}
+
+	if _, err := hostConn.Write(append(serverPub[:], serverConnID[:]...)); err != nil {
+		return nil, fmt.Errorf("unable to send handshake message: %v", err)
+	}
+
+	clientMsg := make([]byte, x25519KeyLen+connIDLen)
+	if err := readDataFromSocket(hostConn, clientMsg, len(clientMsg)); err != nil {
+		return nil, fmt.Errorf("unable to read client handshake message: %v", err)
+	}
+	var clientPub [x25519KeyLen]byte
+	copy(clientPub[:], clientMsg[:x25519KeyLen])
+	var clientConnID [connIDLen]byte
+	copy(clientConnID[:], clientMsg[x25519KeyLen:])
+
+	shared, err := curve25519.X25519(serverPriv[:], clientPub[:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute shared secret: %v", err)
+	}
+
+	readKey, err := deriveSessionKey(shared, psk, clientPub[:], serverPub[:], "client-to-server")
+	if err != nil {
+		return nil, err
+	}
+	writeKey, err := deriveSessionKey(shared, psk, clientPub[:], serverPub[:], "server-to-client")
+	if err != nil {
+		return nil, err
+	}
+
+	readAEAD, err := chacha20poly1305.New(readKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize read cipher: %v", err)
+	}
+	writeAEAD, err := chacha20poly1305.New(writeKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize write cipher: %v", err)
+	}
+
+	conn := &secureConn{
+		Conn:        hostConn,
+		readAEAD:    readAEAD,
+		writeAEAD:   writeAEAD,
+		readConnID:  clientConnID,
+		writeConnID: serverConnID,
+		maxFrameLen: maxFrameLen,
+	}
+
+	if _, err := conn.Write(authConfirmMsg); err != nil {
+		return nil, fmt.Errorf("unable to send auth confirmation: %v", err)
+	}
+	got, err := conn.readFrame()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read auth confirmation, PSK likely mismatched: %v", err)
+	}
+	if !bytes.Equal(got, authConfirmMsg) {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected auth confirmation from %s", hostConn.RemoteAddr())
+	}
+
+	return conn, nil
+}
+
+// deriveSessionKey derives a 32-byte ChaCha20-Poly1305 key via
+// HKDF-SHA256, mixing the ECDH shared secret with the configured PSK in
+// the salt and binding the derivation to both ephemeral public keys and
+// the traffic direction so client->server and server->client frames use
+// independent keys.
+func deriveSessionKey(shared, psk, clientPub, serverPub []byte, direction string) ([]byte, error) {
+	salt := append(append([]byte{}, psk...), append(clientPub, serverPub...)...)
+	kdf := hkdf.New(sha256.New, shared, salt, []byte(direction))
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("unable to derive %s session key: %v", direction, err)
+	}
+	return key, nil
+}
+
+// secureConn wraps a net.Conn so that every frame written is sealed and
+// every frame read is opened with ChaCha20-Poly1305, using a per-frame
+// nonce built from a monotonically increasing 64-bit counter and a random
+// 32-bit connection ID. Frames whose AEAD tag fails to verify tear down
+// the session.
+type secureConn struct {
+	net.Conn
+
+	readAEAD  cipher.AEAD
+	writeAEAD cipher.AEAD
+
+	readConnID  [connIDLen]byte
+	writeConnID [connIDLen]byte
+
+	readCounter  uint64
+	writeCounter uint64
+
+	// maxFrameLen bounds the ciphertext length readFrame will allocate
+	// for, so an attacker-controlled length prefix can't force an
+	// arbitrarily large allocation before the AEAD tag is even checked.
+	maxFrameLen int
+
+	plaintextBuf []byte
+}
+
+func frameNonce(connID [connIDLen]byte, counter uint64) []byte {
+	nonce := make([]byte, nonceCounterLen+connIDLen)
+	binary.BigEndian.PutUint64(nonce[:nonceCounterLen], counter)
+	copy(nonce[nonceCounterLen:], connID[:])
+	return nonce
+}
+
+// Write seals data as a single frame: [4-byte length][ciphertext+tag].
+func (c *secureConn) Write(data []byte) (int, error) {
+	nonce := frameNonce(c.writeConnID, c.writeCounter)
+	c.writeCounter++
+
+	sealed := c.writeAEAD.Seal(nil, nonce, data, nil)
+
+	lenPrefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenPrefix, uint32(len(sealed)))
+
+	if _, err := c.Conn.Write(lenPrefix); err != nil {
+		return 0, fmt.Errorf("unable to write frame length: %v", err)
+	}
+	if _, err := c.Conn.Write(sealed); err != nil {
+		return 0, fmt.Errorf("unable to write sealed frame: %v", err)
+	}
+	return len(data), nil
+}
+
+// Read returns decrypted payload bytes. It reads and opens the next wire
+// frame only once the previous frame's plaintext is used up, so a single
+// call returns bytes from at most one frame.
+func (c *secureConn) Read(out []byte) (int, error) {
+	for len(c.plaintextBuf) == 0 {
+		plaintext, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		c.plaintextBuf = plaintext
+	}
+	n := copy(out, c.plaintextBuf)
+	c.plaintextBuf = c.plaintextBuf[n:]
+	return n, nil
+}
+
+func (c *secureConn) readFrame() ([]byte, error) {
+	lenPrefix := make([]byte, 4)
+	if err := readDataFromSocket(c.Conn, lenPrefix, len(lenPrefix)); err != nil {
+		return nil, err
+	}
+	frameLen := binary.BigEndian.Uint32(lenPrefix)
+	if int(frameLen) > c.maxFrameLen {
+		c.Conn.Close()
+		return nil, fmt.Errorf("frame length %d from %s exceeds max %d, tearing down session", frameLen, c.Conn.RemoteAddr(), c.maxFrameLen)
+	}
+
+	sealed := make([]byte, frameLen)
+	if err := readDataFromSocket(c.Conn, sealed, len(sealed)); err != nil {
+		return nil, err
+	}
+
+	nonce := frameNonce(c.readConnID, c.readCounter)
+	c.readCounter++
+
+	plaintext, err := c.readAEAD.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		c.Conn.Close()
+		return nil, fmt.Errorf("AEAD tag verification failed, tearing down session with %s: %v", c.Conn.RemoteAddr(), err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,99 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestDeriveSessionKeyDeterministicPerDirection(t *testing.T) {
+	shared := bytes.Repeat([]byte{0x01}, 32)
+	psk := []byte("shared-psk")
+	clientPub := bytes.Repeat([]byte{0x02}, x25519KeyLen)
+	serverPub := bytes.Repeat([]byte{0x03}, x25519KeyLen)
+
+	readKey, err := deriveSessionKey(shared, psk, clientPub, serverPub, "client-to-server")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readKeyAgain, err := deriveSessionKey(shared, psk, clientPub, serverPub, "client-to-server")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(readKey, readKeyAgain) {
+		t.Fatal("expected derivation to be deterministic for the same inputs")
+	}
+
+	writeKey, err := deriveSessionKey(shared, psk, clientPub, serverPub, "server-to-client")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Equal(readKey, writeKey) {
+		t.Fatal("expected client-to-server and server-to-client keys to differ")
+	}
+}
+
+func TestDeriveSessionKeyDependsOnPSK(t *testing.T) {
+	shared := bytes.Repeat([]byte{0x01}, 32)
+	clientPub := bytes.Repeat([]byte{0x02}, x25519KeyLen)
+	serverPub := bytes.Repeat([]byte{0x03}, x25519KeyLen)
+
+	keyA, err := deriveSessionKey(shared, []byte("psk-a"), clientPub, serverPub, "client-to-server")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyB, err := deriveSessionKey(shared, []byte("psk-b"), clientPub, serverPub, "client-to-server")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Equal(keyA, keyB) {
+		t.Fatal("expected a different PSK to produce a different session key")
+	}
+}
+
+func TestFrameNonceIncrementsAndIsConnScoped(t *testing.T) {
+	connA := [connIDLen]byte{0x01, 0x02, 0x03, 0x04}
+	connB := [connIDLen]byte{0xAA, 0xBB, 0xCC, 0xDD}
+
+	n0 := frameNonce(connA, 0)
+	n1 := frameNonce(connA, 1)
+	if bytes.Equal(n0, n1) {
+		t.Fatal("expected nonce to change as the counter increments")
+	}
+	if len(n0) != nonceCounterLen+connIDLen {
+		t.Fatalf("unexpected nonce length %d", len(n0))
+	}
+
+	nOther := frameNonce(connB, 0)
+	if bytes.Equal(n0, nOther) {
+		t.Fatal("expected nonce to differ across connection IDs at the same counter value")
+	}
+}
+
+// TestSecureConnReadFrameRejectsOversizedLength guards against the
+// allocation bug fixed alongside this test: an attacker-controlled length
+// prefix must be rejected before readFrame ever allocates a buffer for it.
+func TestSecureConnReadFrameRejectsOversizedLength(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	conn := &secureConn{Conn: serverSide, maxFrameLen: 1024}
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], 1<<31)
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := conn.readFrame()
+		errChan <- err
+	}()
+
+	if _, err := clientSide.Write(lenPrefix[:]); err != nil {
+		t.Fatalf("unable to write oversized length prefix: %v", err)
+	}
+
+	if err := <-errChan; err == nil {
+		t.Fatal("expected readFrame to reject a frame length beyond maxFrameLen")
+	}
+}
@@ -0,0 +1,23 @@
+package streamer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	droppedFramesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "packetstreamer_dropped_frames_total",
+		Help: "Number of captured frames dropped by the receiver because a queue was full.",
+	})
+
+	creditsAvailable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "packetstreamer_credits_available",
+		Help: "Number of frames the receiver's per-connection queue currently has room to accept.",
+	}, []string{"remote_addr"})
+
+	bytesInTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "packetstreamer_bytes_in_total",
+		Help: "Total bytes of frame data accepted from clients by the receiver.",
+	})
+)
@@ -0,0 +1,261 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/deepfence/PacketStreamer/pkg/logging"
+)
+
+// Frame types carried by the mux layer. Every frame on the wire is
+// [4-byte stream ID][1-byte frame type][4-byte payload length][payload].
+const (
+	muxFrameData         byte = 0
+	muxFrameControlOpen  byte = 1
+	muxFrameControlClose byte = 2
+)
+
+const muxFrameHeaderLen = 4 + 1 + 4
+
+// streamMeta describes a logical capture stream as advertised by the
+// sender in a control-open frame.
+type streamMeta struct {
+	Iface          string
+	Filter         string
+	SensorHostname string
+}
+
+// muxConn adapts a single logical stream carried over a shared connection
+// into a net.Conn, so readPkts/decompressPkts can consume it exactly as
+// they would a dedicated TCP connection.
+type muxConn struct {
+	streamID uint32
+	session  *muxSession
+	meta     streamMeta
+
+	dataChan  chan []byte
+	closeChan chan struct{}
+	closeOnce sync.Once
+	pending   []byte
+}
+
+func (c *muxConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		select {
+		case data, ok := <-c.dataChan:
+			if !ok {
+				return 0, io.EOF
+			}
+			c.pending = data
+		case <-c.closeChan:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *muxConn) Write(p []byte) (int, error) {
+	if err := writeMuxFrame(c.session.conn, c.streamID, muxFrameData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *muxConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeChan)
+		c.session.removeStream(c.streamID)
+	})
+	return nil
+}
+
+func (c *muxConn) LocalAddr() net.Addr  { return c.session.conn.LocalAddr() }
+func (c *muxConn) RemoteAddr() net.Addr { return c.session.conn.RemoteAddr() }
+
+// Read/write deadlines belong to the shared underlying connection, which
+// muxSession.run manages on behalf of every stream; per-stream calls are
+// no-ops so callers written against a plain net.Conn keep working.
+func (c *muxConn) SetDeadline(t time.Time) error      { return nil }
+func (c *muxConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *muxConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// muxSession demultiplexes one underlying connection into many muxConns,
+// dispatching data frames to the stream they're tagged with and handling
+// control-open/control-close frames that let a sender open and close
+// streams dynamically.
+type muxSession struct {
+	conn net.Conn
+
+	// maxPayloadLen bounds the per-frame allocation run makes, so one
+	// peer can't force an arbitrarily large allocation (and starve every
+	// other stream multiplexed over this same connection) by sending a
+	// bogus length prefix.
+	maxPayloadLen int
+
+	mu      sync.Mutex
+	streams map[uint32]*muxConn
+
+	// NewStreams receives a muxConn whenever the sender opens a new
+	// logical stream via a control-open frame.
+	NewStreams chan *muxConn
+}
+
+func newMuxSession(conn net.Conn, maxPayloadLen int) *muxSession {
+	return &muxSession{
+		conn:          conn,
+		maxPayloadLen: maxPayloadLen,
+		streams:       make(map[uint32]*muxConn),
+		NewStreams:    make(chan *muxConn, 16),
+	}
+}
+
+func (s *muxSession) removeStream(streamID uint32) {
+	s.mu.Lock()
+	delete(s.streams, streamID)
+	s.mu.Unlock()
+}
+
+// run reads frames off the shared connection until it errors out, at
+// which point every still-open stream is closed so its readPkts goroutine
+// unwinds.
+func (s *muxSession) run() {
+	defer s.shutdown()
+
+	header := make([]byte, muxFrameHeaderLen)
+	for {
+		if err := readDataFromSocket(s.conn, header, len(header)); err != nil {
+			logging.Log.WithFields(logrus.Fields{"remote_addr": s.conn.RemoteAddr()}).WithError(err).Error("Mux session read failed")
+			return
+		}
+		streamID := binary.BigEndian.Uint32(header[0:4])
+		frameType := header[4]
+		payloadLen := binary.BigEndian.Uint32(header[5:9])
+		if int(payloadLen) > s.maxPayloadLen {
+			logging.Log.WithFields(logrus.Fields{"remote_addr": s.conn.RemoteAddr(), "stream_id": streamID}).
+				Errorf("Mux frame payload length %d exceeds max %d, tearing down session", payloadLen, s.maxPayloadLen)
+			return
+		}
+
+		payload := make([]byte, payloadLen)
+		if err := readDataFromSocket(s.conn, payload, len(payload)); err != nil {
+			logging.Log.WithFields(logrus.Fields{"remote_addr": s.conn.RemoteAddr()}).WithError(err).Error("Mux session read failed")
+			return
+		}
+
+		switch frameType {
+		case muxFrameControlOpen:
+			s.handleOpen(streamID, payload)
+		case muxFrameControlClose:
+			s.handleClose(streamID)
+		case muxFrameData:
+			s.handleData(streamID, payload)
+		default:
+			logging.Log.WithField("frame_type", frameType).Warn("Unknown mux frame type, discarding")
+		}
+	}
+}
+
+func (s *muxSession) handleOpen(streamID uint32, payload []byte) {
+	meta, err := decodeStreamMeta(payload)
+	if err != nil {
+		logging.Log.WithError(err).Warn("Unable to decode stream metadata, rejecting stream")
+		return
+	}
+	stream := &muxConn{
+		streamID:  streamID,
+		session:   s,
+		meta:      meta,
+		dataChan:  make(chan []byte, maxNumPkts),
+		closeChan: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[streamID] = stream
+	s.mu.Unlock()
+	s.NewStreams <- stream
+}
+
+func (s *muxSession) handleClose(streamID uint32) {
+	s.mu.Lock()
+	stream, ok := s.streams[streamID]
+	delete(s.streams, streamID)
+	s.mu.Unlock()
+	if ok {
+		stream.closeOnce.Do(func() { close(stream.closeChan) })
+	}
+}
+
+func (s *muxSession) handleData(streamID uint32, payload []byte) {
+	s.mu.Lock()
+	stream, ok := s.streams[streamID]
+	s.mu.Unlock()
+	if !ok {
+		logging.Log.WithField("stream_id", streamID).Warn("Data frame for unknown stream, discarding")
+		return
+	}
+	// Block rather than drop when the stream's queue is full, so the
+	// blocking send in readPkts backpressures the shared connection; give
+	// up on the frame only once the stream itself has been closed.
+	select {
+	case stream.dataChan <- payload:
+	case <-stream.closeChan:
+	}
+}
+
+func (s *muxSession) shutdown() {
+	close(s.NewStreams)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, stream := range s.streams {
+		stream.closeOnce.Do(func() { close(stream.closeChan) })
+		delete(s.streams, id)
+	}
+}
+
+// writeMuxFrame writes a single length-prefixed, stream-tagged frame to
+// the shared connection. Callers must serialize writes themselves; the
+// mux layer does not lock conn.Write.
+func writeMuxFrame(conn net.Conn, streamID uint32, frameType byte, payload []byte) error {
+	header := make([]byte, muxFrameHeaderLen)
+	binary.BigEndian.PutUint32(header[0:4], streamID)
+	header[4] = frameType
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("unable to write mux frame header: %v", err)
+	}
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return fmt.Errorf("unable to write mux frame payload: %v", err)
+		}
+	}
+	return nil
+}
+
+// decodeStreamMeta parses the length-prefixed iface/filter/hostname
+// triple carried by a control-open frame.
+func decodeStreamMeta(payload []byte) (streamMeta, error) {
+	var meta streamMeta
+	fields := []*string{&meta.Iface, &meta.Filter, &meta.SensorHostname}
+	offset := 0
+	for _, field := range fields {
+		if offset+2 > len(payload) {
+			return meta, fmt.Errorf("truncated stream metadata")
+		}
+		fieldLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
+		offset += 2
+		if offset+fieldLen > len(payload) {
+			return meta, fmt.Errorf("truncated stream metadata field")
+		}
+		*field = string(payload[offset : offset+fieldLen])
+		offset += fieldLen
+	}
+	return meta, nil
+}
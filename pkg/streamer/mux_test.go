@@ -0,0 +1,70 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func encodeStreamMeta(t *testing.T, meta streamMeta) []byte {
+	t.Helper()
+	var payload []byte
+	for _, field := range []string{meta.Iface, meta.Filter, meta.SensorHostname} {
+		var lenBuf [2]byte
+		binary.BigEndian.PutUint16(lenBuf[:], uint16(len(field)))
+		payload = append(payload, lenBuf[:]...)
+		payload = append(payload, field...)
+	}
+	return payload
+}
+
+func TestDecodeStreamMetaRoundTrip(t *testing.T) {
+	want := streamMeta{Iface: "eth0", Filter: "tcp port 80", SensorHostname: "sensor-1"}
+	got, err := decodeStreamMeta(encodeStreamMeta(t, want))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeStreamMetaTruncated(t *testing.T) {
+	if _, err := decodeStreamMeta([]byte{0x00}); err == nil {
+		t.Fatal("expected error for truncated metadata")
+	}
+}
+
+func TestDecodeStreamMetaTruncatedField(t *testing.T) {
+	payload := []byte{0x00, 0x05, 'e', 't', 'h'} // claims a 5-byte field but only has 3
+	if _, err := decodeStreamMeta(payload); err == nil {
+		t.Fatal("expected error for truncated metadata field")
+	}
+}
+
+// TestMuxSessionRejectsOversizedPayload guards against the allocation bug
+// fixed alongside this test: an attacker-controlled payload length must
+// be rejected before run ever allocates a buffer for it.
+func TestMuxSessionRejectsOversizedPayload(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	session := newMuxSession(serverSide, 1024)
+
+	done := make(chan struct{})
+	go func() {
+		session.run()
+		close(done)
+	}()
+
+	header := make([]byte, muxFrameHeaderLen)
+	binary.BigEndian.PutUint32(header[0:4], 1)
+	header[4] = muxFrameData
+	binary.BigEndian.PutUint32(header[5:9], 1<<31)
+
+	if _, err := clientSide.Write(header); err != nil {
+		t.Fatalf("unable to write oversized mux frame header: %v", err)
+	}
+
+	<-done // run must return (tearing down the session) instead of hanging on a huge allocation
+}
@@ -0,0 +1,164 @@
+package streamer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxyProtoV1Prefix is the leading token of a PROXY protocol v1 header.
+var proxyProtoV1Prefix = []byte("PROXY ")
+
+// proxyProtoV2Sig is the fixed 12-byte signature that opens a v2 header.
+var proxyProtoV2Sig = [...]byte{
+	0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A,
+}
+
+const (
+	proxyProtoV2CmdLocal = 0x0
+	proxyProtoV2CmdProxy = 0x1
+
+	proxyProtoV2AFUnspec = 0x0
+	proxyProtoV2AFInet   = 0x1
+	proxyProtoV2AFInet6  = 0x2
+	proxyProtoV2AFUnix   = 0x3
+)
+
+// proxyProtoConn wraps a net.Conn, overriding RemoteAddr with the real
+// client address decoded from a PROXY protocol header so that downstream
+// logs and per-source metrics don't report the L4 loadbalancer peer.
+type proxyProtoConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// wrapProxyProtocol peeks at the start of hostConn, decodes a PROXY
+// protocol v1 or v2 header if one is present, and returns a net.Conn
+// whose RemoteAddr() reflects the original client rather than the proxy.
+// mode is one of "off", "optional", "require".
+func wrapProxyProtocol(hostConn net.Conn, mode string) (net.Conn, error) {
+	if mode == "" || mode == "off" {
+		return hostConn, nil
+	}
+
+	reader := bufio.NewReader(hostConn)
+	conn := &proxyProtoConn{Conn: hostConn, reader: reader}
+
+	sig, err := reader.Peek(len(proxyProtoV2Sig))
+	if err == nil && bytes.Equal(sig, proxyProtoV2Sig[:]) {
+		addr, perr := readProxyProtoV2(reader)
+		if perr != nil {
+			return nil, perr
+		}
+		conn.remoteAddr = addr
+		return conn, nil
+	}
+
+	prefix, err := reader.Peek(len(proxyProtoV1Prefix))
+	if err == nil && bytes.Equal(prefix, proxyProtoV1Prefix) {
+		addr, perr := readProxyProtoV1(reader)
+		if perr != nil {
+			return nil, perr
+		}
+		conn.remoteAddr = addr
+		return conn, nil
+	}
+
+	if mode == "require" {
+		return nil, fmt.Errorf("PROXY protocol required but no header found from %s", hostConn.RemoteAddr())
+	}
+	return conn, nil
+}
+
+// readProxyProtoV1 consumes a "PROXY ..." line terminated by \r\n and
+// returns the source address it describes.
+func readProxyProtoV1(reader *bufio.Reader) (net.Addr, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PROXY v1 header: %v", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed PROXY v1 header: %q", line)
+	}
+
+	family := fields[1]
+	if family == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("malformed PROXY v1 header: %q", line)
+	}
+	srcIP := fields[2]
+	srcPort, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 source port: %q", fields[4])
+	}
+	return &net.TCPAddr{IP: net.ParseIP(srcIP), Port: srcPort}, nil
+}
+
+// readProxyProtoV2 consumes a binary v2 header (already confirmed present
+// via the 12-byte signature) and returns the source address it describes.
+func readProxyProtoV2(reader *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, len(proxyProtoV2Sig)+4)
+	if _, err := io.ReadFull(reader, hdr); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY v2 header: %v", err)
+	}
+
+	verCmd := hdr[12]
+	if verCmd>>4 != 0x2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	cmd := verCmd & 0x0F
+
+	family := hdr[13] >> 4
+	addrLen := binary.BigEndian.Uint16(hdr[14:16])
+
+	addrBytes := make([]byte, addrLen)
+	if _, err := io.ReadFull(reader, addrBytes); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY v2 address block: %v", err)
+	}
+
+	if cmd == proxyProtoV2CmdLocal {
+		return nil, nil
+	}
+
+	switch family {
+	case proxyProtoV2AFInet:
+		if addrLen < 12 {
+			return nil, fmt.Errorf("short PROXY v2 IPv4 address block")
+		}
+		srcIP := net.IP(addrBytes[0:4])
+		srcPort := binary.BigEndian.Uint16(addrBytes[8:10])
+		return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, nil
+	case proxyProtoV2AFInet6:
+		if addrLen < 36 {
+			return nil, fmt.Errorf("short PROXY v2 IPv6 address block")
+		}
+		srcIP := net.IP(addrBytes[0:16])
+		srcPort := binary.BigEndian.Uint16(addrBytes[32:34])
+		return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, nil
+	case proxyProtoV2AFUnspec, proxyProtoV2AFUnix:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 address family %d", family)
+	}
+}
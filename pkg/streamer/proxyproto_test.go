@@ -0,0 +1,89 @@
+package streamer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyProtoV1(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nrest"))
+	addr, err := readProxyProtoV1(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", addr)
+	}
+	if !tcpAddr.IP.Equal(net.ParseIP("192.168.0.1")) || tcpAddr.Port != 56324 {
+		t.Fatalf("unexpected addr: %+v", tcpAddr)
+	}
+}
+
+func TestReadProxyProtoV1Unknown(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\nrest"))
+	addr, err := readProxyProtoV1(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addr != nil {
+		t.Fatalf("expected nil addr for UNKNOWN family, got %+v", addr)
+	}
+}
+
+func TestReadProxyProtoV1Malformed(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY TCP4\r\n"))
+	if _, err := readProxyProtoV1(reader); err == nil {
+		t.Fatal("expected error for malformed v1 header")
+	}
+}
+
+func buildProxyV2IPv4(t *testing.T, srcIP string, srcPort uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(proxyProtoV2Sig[:])
+	buf.WriteByte(0x21) // version 2, command PROXY
+	buf.WriteByte(0x11) // AF_INET, STREAM
+	addr := make([]byte, 12)
+	copy(addr[0:4], net.ParseIP(srcIP).To4())
+	copy(addr[4:8], net.ParseIP("10.0.0.1").To4())
+	binary.BigEndian.PutUint16(addr[8:10], srcPort)
+	binary.BigEndian.PutUint16(addr[10:12], 443)
+	var lenBuf [2]byte
+	binary.BigEndian.PutUint16(lenBuf[:], uint16(len(addr)))
+	buf.Write(lenBuf[:])
+	buf.Write(addr)
+	return buf.Bytes()
+}
+
+func TestReadProxyProtoV2IPv4(t *testing.T) {
+	data := buildProxyV2IPv4(t, "203.0.113.5", 56324)
+	reader := bufio.NewReader(bytes.NewReader(data))
+	addr, err := readProxyProtoV2(reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", addr)
+	}
+	if !tcpAddr.IP.Equal(net.ParseIP("203.0.113.5")) || tcpAddr.Port != 56324 {
+		t.Fatalf("unexpected addr: %+v", tcpAddr)
+	}
+}
+
+func TestReadProxyProtoV2UnsupportedVersion(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(proxyProtoV2Sig[:])
+	buf.WriteByte(0x11) // version 1 (unsupported), command PROXY
+	buf.WriteByte(0x11)
+	buf.Write([]byte{0x00, 0x00})
+	reader := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	if _, err := readProxyProtoV2(reader); err == nil {
+		t.Fatal("expected error for unsupported PROXY protocol version")
+	}
+}
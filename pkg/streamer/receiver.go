@@ -11,7 +11,11 @@ import (
 	"os"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/deepfence/PacketStreamer/pkg/config"
+	"github.com/deepfence/PacketStreamer/pkg/logging"
+	"github.com/deepfence/PacketStreamer/pkg/output"
 )
 
 const (
@@ -25,15 +29,30 @@ var (
 	hdrData = [...]byte{0xde, 0xef, 0xec, 0xe0}
 )
 
+// sessionID returns the most specific identifier available for conn's
+// logical session: a mux stream ID when conn is multiplexed, the crypto
+// connection ID when conn is an authenticated session, or the remote
+// address as a fallback for a plain connection.
+func sessionID(conn net.Conn) string {
+	switch c := conn.(type) {
+	case *muxConn:
+		return fmt.Sprintf("stream-%d", c.streamID)
+	case *secureConn:
+		return fmt.Sprintf("conn-%x", c.writeConnID)
+	default:
+		return conn.RemoteAddr().String()
+	}
+}
+
 func readDataFromSocket(hostConn net.Conn, dataBuff []byte, bytesToRead int) error {
 
 	totalBytesRead := 0
+	logFields := logrus.Fields{"remote_addr": hostConn.RemoteAddr(), "session_id": sessionID(hostConn)}
 
 	for {
 		deadLineErr := hostConn.SetReadDeadline(time.Now().Add(connTimeout * time.Second))
 		if deadLineErr != nil {
-			log.Println(fmt.Sprintf("Unable to set timeout for connection from %s. Reason %v",
-				hostConn.RemoteAddr(), deadLineErr))
+			logging.Log.WithFields(logFields).WithError(deadLineErr).Error("Unable to set read deadline")
 		}
 		bytesRead, readErr := hostConn.Read(dataBuff[totalBytesRead:])
 		if (readErr != nil) && (readErr != io.EOF) && !os.IsTimeout(readErr) {
@@ -46,11 +65,11 @@ func readDataFromSocket(hostConn net.Conn, dataBuff []byte, bytesToRead int) err
 			return readErr
 		}
 		if (bytesRead == 0) && (readErr != nil) {
-			log.Printf("Zero bytes received from client. Error reason %v\n", readErr)
+			logging.Log.WithFields(logFields).WithError(readErr).Debug("Zero bytes received from client")
 			return nil
 		}
 		if (bytesRead == 0) && (readErr == nil) {
-			log.Println("Zero bytes received from client. No errors")
+			logging.Log.WithFields(logFields).Debug("Zero bytes received from client. No errors")
 			return nil
 		}
 		totalBytesRead += bytesRead
@@ -64,12 +83,19 @@ func readPkts(clientConn net.Conn, config *config.Config, pktUncompressChannel c
 
 	var dataBuff = make([]byte, config.CompressBlockSize * kilobyte)
 	var totalHdrLen = len(hdrData) + payloadMarkerLen + compressFlagByteLen
+	logFields := logrus.Fields{"remote_addr": clientConn.RemoteAddr(), "session_id": sessionID(clientConn)}
+
+	credits := newCreditController(clientConn, pktUncompressChannel)
+	go credits.run()
+	defer credits.stop()
 
 	for {
 		err := readDataFromSocket(clientConn, dataBuff[0:totalHdrLen], totalHdrLen)
 		if err != nil {
 			if !os.IsTimeout(err) {
-				log.Printf("Unable to read data from connection. %v\n", err)
+				logging.Log.WithFields(logFields).WithError(err).Error("Unable to read data from connection")
+			} else {
+				logging.Log.WithFields(logFields).WithError(err).Debug("Timed out reading data from connection")
 			}
 			clientConn.Close()
 			close(pktUncompressChannel)
@@ -77,21 +103,21 @@ func readPkts(clientConn net.Conn, config *config.Config, pktUncompressChannel c
 		}
 		compareRes := bytes.Compare(dataBuff[0:len(hdrData)], hdrData[:])
 		if compareRes != 0 {
-			log.Printf("Illegal data received from client")
+			logging.Log.WithFields(logFields).Error("Illegal data received from client")
 			clientConn.Close()
 			close(pktUncompressChannel)
 			return
 		}
 		compressedDataLen := binary.LittleEndian.Uint32(dataBuff[len(hdrData):])
 		if int(compressedDataLen) > ((config.CompressBlockSize * kilobyte) - totalHdrLen) {
-			log.Printf("Invalid buffer length %d obtained from client", compressedDataLen)
+			logging.Log.WithFields(logFields).WithField("bytes", compressedDataLen).Error("Invalid buffer length obtained from client")
 			clientConn.Close()
 			close(pktUncompressChannel)
 			return
 		}
 		err = readDataFromSocket(clientConn, dataBuff[totalHdrLen:(totalHdrLen+int(compressedDataLen))], int(compressedDataLen))
 		if err != nil {
-			log.Printf("Unable to read data from connection. %s\n", err)
+			logging.Log.WithFields(logFields).WithError(err).Error("Unable to read data from connection")
 			clientConn.Close()
 			close(pktUncompressChannel)
 			return
@@ -100,21 +126,47 @@ func readPkts(clientConn net.Conn, config *config.Config, pktUncompressChannel c
 			Data: string(dataBuff[totalHdrLen:(int(compressedDataLen) + totalHdrLen)]),
 			IsCompressed: dataBuff[len(hdrData)+payloadMarkerLen] != 0,
 		}
+		frameLen := totalHdrLen + int(compressedDataLen)
+		// Accepting this frame is the thing credits grant permission for,
+		// so enforce that grant by blocking here instead of dropping: a
+		// full channel means the sender has outrun its credits (or the
+		// decompress worker has stalled), and the receiver should stop
+		// pulling more data off the wire until there's room, not silently
+		// discard it.
+		pktUncompressChannel <- dataToUncompress
+		bytesInTotal.Add(float64(frameLen))
 		select {
-		case pktUncompressChannel <- dataToUncompress:
+		case sizeChannel <- frameLen:
 		default:
-			log.Println("Uncompress queue is full. Discarding")
-		}
-		select {
-		case sizeChannel <- (totalHdrLen + int(compressedDataLen)):
-		default:
-			log.Println("Size queue is full. Discarding")
+			// sizeChannel only feeds the best-effort throughput counter,
+			// not captured packet data, so it keeps its non-blocking
+			// drop policy.
+			droppedFramesTotal.Inc()
+			logging.Log.WithFields(logFields).Warn("Size queue is full. Discarding")
 		}
 	}
 }
 
 func receiverOutput(config *config.Config, consolePktOutputChannel chan string) {
 
+	if len(config.Output.Sinks) > 0 {
+		outputManager, err := output.NewManager(config)
+		if err != nil {
+			logging.Log.WithError(err).Error("Unable to start output sinks")
+			return
+		}
+		defer outputManager.Close()
+
+		for {
+			tmpData, chanExitVal := <-consolePktOutputChannel
+			if !chanExitVal {
+				logging.Log.Error("Error while reading from output channel")
+				return
+			}
+			outputManager.Write([]byte(tmpData))
+		}
+	}
+
 	for {
 		tmpData, chanExitVal := <-consolePktOutputChannel
 
@@ -131,31 +183,31 @@ func receiverOutput(config *config.Config, consolePktOutputChannel chan string)
 
 func processHost(config *config.Config, consolePktOutputChannel chan string, proto string) {
 
-	var err error
-	var listener net.Listener
 	addr := config.Input.Address
 	if config.Input.Port != nil {
 		addr = fmt.Sprintf("%s:%d", config.Input.Address, *config.Input.Port)
 	}
 
+	// The listener is always plain TCP, even with TLS enabled: a PROXY
+	// protocol header (when config.Input.ProxyProtocol is set) arrives as
+	// plaintext ahead of the TLS ClientHello on the same stream, so it
+	// must be decoded before any TLS handshake is attempted on the
+	// connection. The TLS handshake itself happens per-connection in
+	// handleConn, on whatever plaintext remains once the header is gone.
+	var tlsConfig *tls.Config
 	if config.TLS.Enable {
-		config, err := getTlsConfig(config.TLS.CertFile, config.TLS.KeyFile, "")
-		if err != nil {
-			log.Println("Unable to start TLS listener: "+err.Error())
-			return
-		}
-		listener, err = tls.Listen(proto, addr, config)
-		if err != nil {
-			log.Println("Unable to start TLS listener socket "+err.Error(), proto, addr, config)
-			return
-		}
-	} else {
-		listener, err = net.Listen(proto, addr)
+		var err error
+		tlsConfig, err = getTlsConfig(config.TLS.CertFile, config.TLS.KeyFile, "")
 		if err != nil {
-			log.Println("Unable to start listener socket "+err.Error(), proto, addr)
+			logging.Log.WithError(err).Error("Unable to start TLS listener")
 			return
 		}
 	}
+	listener, err := net.Listen(proto, addr)
+	if err != nil {
+		logging.Log.WithFields(logrus.Fields{"proto": proto, "addr": addr}).WithError(err).Error("Unable to start listener socket")
+		return
+	}
 
 	sizeChannel := make(chan int, maxNumPkts)
 	go calculateDataSize(sizeChannel)
@@ -163,25 +215,89 @@ func processHost(config *config.Config, consolePktOutputChannel chan string, pro
 	for {
 		hostConn, cerr := listener.Accept()
 		if cerr != nil {
-			log.Println("Unable to accept connections on socket " + cerr.Error())
+			logging.Log.WithError(cerr).Error("Unable to accept connections on socket")
 			break
-		} else {
-			log.Println("Accepted connection on socket: ", proto, hostConn.RemoteAddr())
-		}
-		if config.Auth.Enable {
-			go func() {
-				if handleServerAuth(hostConn) {
-					pktUncompressChannel := make(chan CompressData, maxNumPkts)
-					go decompressPkts(config, pktUncompressChannel, consolePktOutputChannel)
-					go readPkts(hostConn, config, pktUncompressChannel, sizeChannel)
-				}
-			}()
-			continue
 		}
+		logging.Log.WithFields(logrus.Fields{"proto": proto, "remote_addr": hostConn.RemoteAddr()}).Info("Accepted connection on socket")
+		go handleConn(config, tlsConfig, hostConn, consolePktOutputChannel, sizeChannel)
+	}
+}
+
+// handleConn unwraps any PROXY protocol header, completes the TLS
+// handshake (if enabled) on the plaintext stream that remains, and hands
+// the connection off to auth and stream consumption. It runs in its own
+// goroutine per connection, so a client that never finishes sending its
+// PROXY protocol header (or TLS ClientHello) only stalls itself rather
+// than the shared accept loop in processHost.
+func handleConn(config *config.Config, tlsConfig *tls.Config, hostConn net.Conn, consolePktOutputChannel chan string, sizeChannel chan int) {
+	if derr := hostConn.SetReadDeadline(time.Now().Add(connTimeout * time.Second)); derr != nil {
+		logging.Log.WithFields(logrus.Fields{"remote_addr": hostConn.RemoteAddr()}).WithError(derr).Error("Unable to set read deadline")
+	}
+	wrappedConn, perr := wrapProxyProtocol(hostConn, config.Input.ProxyProtocol)
+	if perr != nil {
+		logging.Log.WithFields(logrus.Fields{"remote_addr": hostConn.RemoteAddr()}).WithError(perr).Error("Rejecting connection")
+		hostConn.Close()
+		return
+	}
+	hostConn = wrappedConn
+	if derr := hostConn.SetReadDeadline(time.Time{}); derr != nil {
+		logging.Log.WithFields(logrus.Fields{"remote_addr": hostConn.RemoteAddr()}).WithError(derr).Error("Unable to clear read deadline")
+	}
+
+	if tlsConfig != nil {
+		hostConn = tls.Server(hostConn, tlsConfig)
+	}
+
+	if config.Auth.Enable {
+		if config.Auth.Key != "" {
+			securedConn, herr := performAuthHandshake(hostConn, config)
+			if herr != nil {
+				logging.Log.WithFields(logrus.Fields{"remote_addr": hostConn.RemoteAddr()}).WithError(herr).Error("Auth handshake failed")
+				hostConn.Close()
+				return
+			}
+			logging.Log.WithFields(logrus.Fields{"remote_addr": hostConn.RemoteAddr(), "session_id": sessionID(securedConn)}).Info("Auth handshake complete")
+			startStreamConsumers(config, securedConn, consolePktOutputChannel, sizeChannel)
+			return
+		}
+		if handleServerAuth(hostConn) {
+			startStreamConsumers(config, hostConn, consolePktOutputChannel, sizeChannel)
+		}
+		return
+	}
+	startStreamConsumers(config, hostConn, consolePktOutputChannel, sizeChannel)
+}
+
+// startStreamConsumers wires up decompressPkts+readPkts for whatever
+// logical capture streams arrive on conn. With config.Input.Multiplexed
+// set, conn may carry many streams tagged by ID over the mux layer, each
+// getting its own pair of goroutines and channels; otherwise conn itself
+// is treated as the single stream, preserving the original 1-connection-
+// 1-stream behavior.
+func startStreamConsumers(config *config.Config, conn net.Conn, consolePktOutputChannel chan string, sizeChannel chan int) {
+	if !config.Input.Multiplexed {
 		pktUncompressChannel := make(chan CompressData, maxNumPkts)
 		go decompressPkts(config, pktUncompressChannel, consolePktOutputChannel)
-		go readPkts(hostConn, config, pktUncompressChannel, sizeChannel)
+		go readPkts(conn, config, pktUncompressChannel, sizeChannel)
+		return
 	}
+
+	session := newMuxSession(conn, config.CompressBlockSize*kilobyte)
+	go session.run()
+	go func() {
+		for stream := range session.NewStreams {
+			logging.Log.WithFields(logrus.Fields{
+				"remote_addr": conn.RemoteAddr(),
+				"session_id":  sessionID(stream),
+				"iface":       stream.meta.Iface,
+				"filter":      stream.meta.Filter,
+				"sensor":      stream.meta.SensorHostname,
+			}).Info("Opened mux stream")
+			pktUncompressChannel := make(chan CompressData, maxNumPkts)
+			go decompressPkts(config, pktUncompressChannel, consolePktOutputChannel)
+			go readPkts(stream, config, pktUncompressChannel, sizeChannel)
+		}
+	}()
 }
 
 func StartReceiver(config *config.Config, proto string, mainSignalChannel chan bool) {